@@ -0,0 +1,112 @@
+// Command mkvector captures a conformance test vector from a live
+// marketstore instance, so the frontend/conformance corpus can be kept
+// up to date as the wire format evolves. See frontend/conformance for how
+// the captured fixtures are replayed.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"path/filepath"
+
+	"github.com/alpacahq/marketstore/frontend"
+	"github.com/alpacahq/marketstore/frontend/client"
+	"github.com/alpacahq/marketstore/frontend/conformance"
+	"github.com/alpacahq/marketstore/utils/rpc/msgpack2"
+)
+
+var (
+	addr   = flag.String("addr", "http://localhost:5993", "base URL of the live marketstore instance")
+	method = flag.String("method", "Query", "DataService method to capture, e.g. Query")
+	args   = flag.String("args", "{}", "JSON-encoded request args for the method")
+	name   = flag.String("name", "vector", "base name for the captured fixture files")
+	outDir = flag.String("out", "frontend/conformance/testdata/vectors", "directory to write the fixture pair into")
+)
+
+func main() {
+	flag.Parse()
+
+	var decodedArgs interface{}
+	if err := json.Unmarshal([]byte(*args), &decodedArgs); err != nil {
+		log.Fatalf("invalid -args (%v)", err)
+	}
+
+	response := captureResponse(*addr, *method, decodedArgs)
+
+	responseFile := *name + ".msgpack"
+	if err := ioutil.WriteFile(filepath.Join(*outDir, responseFile), response, 0o644); err != nil {
+		log.Fatalf("writing response fixture (%v)", err)
+	}
+
+	manifest := conformance.ClientVector{
+		Name:         *name,
+		Method:       *method,
+		Args:         decodedArgs,
+		ResponseFile: responseFile,
+		Expected:     decodeExpected(*method, response),
+	}
+
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		log.Fatalf("encoding manifest (%v)", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(*outDir, *name+".json"), manifestBytes, 0o644); err != nil {
+		log.Fatalf("writing manifest (%v)", err)
+	}
+
+	log.Printf("captured vector %s (%d response bytes)", *name, len(response))
+}
+
+// captureResponse issues the same msgpack2 RPC request Client.DoRPC would,
+// and returns the raw, still-encoded response body so it can be stored and
+// replayed byte-for-byte by RunClientVectors.
+func captureResponse(addr, method string, args interface{}) []byte {
+	message, err := msgpack2.EncodeClientRequest("DataService."+method, args)
+	if err != nil {
+		log.Fatalf("encoding request (%v)", err)
+	}
+
+	req, err := http.NewRequest("POST", addr+"/rpc", bytes.NewBuffer(message))
+	if err != nil {
+		log.Fatalf("building request (%v)", err)
+	}
+	req.Header.Set("Content-Type", "application/x-msgpack")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Fatalf("rpc call failed (%v)", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		log.Fatalf("reading response (%v)", err)
+	}
+	return body
+}
+
+// decodeExpected decodes the bytes already captured by captureResponse the
+// same way Client.DoRPC would, so the manifest's expected values describe
+// exactly the response that was saved to the fixture file rather than a
+// second, independently-timed call to the live server.
+func decodeExpected(method string, response []byte) map[string]map[string]interface{} {
+	switch method {
+	case "Query", "SQLStatement":
+		result := &frontend.MultiQueryResponse{}
+		if err := msgpack2.DecodeClientResponse(bytes.NewReader(response), result); err != nil {
+			log.Fatalf("decoding captured response (%v)", err)
+		}
+		csm, err := client.ConvertMultiQueryReplyToColumnSeries(result)
+		if err != nil {
+			log.Fatalf("converting captured response (%v)", err)
+		}
+		return conformance.ColumnSeriesMapToExpected(csm)
+	default:
+		log.Fatalf("unsupported RPC response %q", method)
+		return nil
+	}
+}
@@ -0,0 +1,71 @@
+// Package api is a thin client for the Polygon.io REST endpoints the
+// polygon bgworker needs: aggregate bars for backfilling gaps left by a
+// streaming outage.
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var (
+	apiKey  string
+	baseURL = "https://api.polygon.io"
+)
+
+// SetAPIKey sets the API key sent with every request.
+func SetAPIKey(key string) {
+	apiKey = key
+}
+
+// SetBaseURL overrides the default Polygon API base URL, e.g. to point at
+// a proxy.
+func SetBaseURL(url string) {
+	baseURL = url
+}
+
+// Bar is a single aggregate bar as returned by Polygon's v2 aggregates
+// endpoint.
+type Bar struct {
+	EpochMillis int64   `json:"t"`
+	Open        float64 `json:"o"`
+	High        float64 `json:"h"`
+	Low         float64 `json:"l"`
+	Close       float64 `json:"c"`
+	Volume      float64 `json:"v"`
+}
+
+// AggregatesResponse is the decoded response body of a GetAggregates call.
+type AggregatesResponse struct {
+	Ticks []Bar `json:"results"`
+}
+
+// GetAggregates fetches aggregate bars for symbol from the given start time
+// through now, at the given multiplier/timespan (e.g. 1/"minute",
+// 5/"minute", 1/"hour", 1/"day"), matching Polygon's v2 aggregates
+// endpoint: /v2/aggs/ticker/{symbol}/range/{multiplier}/{timespan}/{from}/{to}.
+func GetAggregates(symbol string, multiplier int, timespan string, from time.Time) (*AggregatesResponse, error) {
+	reqURL := fmt.Sprintf("%s/v2/aggs/ticker/%s/range/%d/%s/%d/%d?apiKey=%s",
+		baseURL, symbol, multiplier, timespan,
+		from.UnixNano()/int64(time.Millisecond),
+		time.Now().UnixNano()/int64(time.Millisecond),
+		apiKey)
+
+	resp, err := http.Get(reqURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("polygon aggregates request failed (%d)", resp.StatusCode)
+	}
+
+	result := &AggregatesResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -1,234 +1,533 @@
 package main
 
-// import (
-// 	"encoding/json"
-// 	"fmt"
-// 	"sync"
-// 	"time"
-
-// 	"github.com/buger/jsonparser"
-
-// 	"github.com/alpacahq/marketstore/contrib/polygon/api"
-// 	"github.com/alpacahq/marketstore/executor"
-// 	"github.com/alpacahq/marketstore/planner"
-// 	"github.com/alpacahq/marketstore/plugins/bgworker"
-// 	"github.com/alpacahq/marketstore/utils/io"
-// 	"github.com/golang/glog"
-// 	nats "github.com/nats-io/go-nats"
-// )
-
-// type PolygonFetcher struct {
-// 	sync.Mutex
-// 	config      FetcherConfig
-// 	backfillM   sync.Map
-// 	csm         *io.ColumnSeriesMap
-// 	refreshedAt time.Time
-// }
-
-// func (f *PolygonFetcher) CSM() io.ColumnSeriesMap {
-// 	return *f.csm
-// }
-
-// func (f *PolygonFetcher) Refresh() {
-// 	csm := io.NewColumnSeriesMap()
-// 	f.csm = &csm
-// 	f.refreshedAt = time.Now()
-// }
-
-// func (f *PolygonFetcher) Age() time.Duration {
-// 	return time.Now().Sub(f.refreshedAt)
-// }
-
-// type FetcherConfig struct {
-// 	// polygon API key for authenticating with their APIs
-// 	APIKey string `json:"api_key"`
-// 	// polygon API base URL in case it is being proxied
-// 	// (defaults to https://api.polygon.io/)
-// 	BaseURL string `json:"base_url"`
-// }
-
-// // NewBgWorker returns a new instances of PolygonFetcher. See FetcherConfig
-// // for more details about configuring PolygonFetcher.
-// func NewBgWorker(conf map[string]interface{}) (bgworker.BgWorker, error) {
-// 	data, _ := json.Marshal(conf)
-// 	config := FetcherConfig{}
-// 	json.Unmarshal(data, &config)
-
-// 	fetcher := &PolygonFetcher{
-// 		backfillM: sync.Map{},
-// 		config:    config,
-// 	}
-
-// 	fetcher.Refresh()
-
-// 	return fetcher, nil
-// }
-
-// // Run the PolygonFetcher. It starts the streaming API as well as the
-// // asynchronous backfilling routine.
-// func (pf *PolygonFetcher) Run() {
-// 	api.SetAPIKey(pf.config.APIKey)
-
-// 	if pf.config.BaseURL != "" {
-// 		api.SetBaseURL(pf.config.BaseURL)
-// 	}
-
-// 	go pf.workBackfill()
-
-// 	if err := api.Stream(pf.streamHandler); err != nil {
-// 		glog.Fatalf("nats streaming error (%v)", err)
-// 	}
-
-// 	select {}
-// }
-
-// func (pf *PolygonFetcher) streamHandler(msg *nats.Msg) {
-
-// 	// quickly parse the data
-// 	symbol, _ := jsonparser.GetString(msg.Data, "sym")
-// 	open, _ := jsonparser.GetFloat(msg.Data, "o")
-// 	high, _ := jsonparser.GetFloat(msg.Data, "h")
-// 	low, _ := jsonparser.GetFloat(msg.Data, "l")
-// 	close, _ := jsonparser.GetFloat(msg.Data, "c")
-// 	volume, _ := jsonparser.GetInt(msg.Data, "v")
-// 	epochMillis, _ := jsonparser.GetInt(msg.Data, "s")
-
-// 	epoch := epochMillis / 1000
-
-// 	pf.backfillM.LoadOrStore(symbol, &epoch)
-
-// 	tbk := io.NewTimeBucketKeyFromString(fmt.Sprintf("%s/1Min/OHLCV", symbol))
-
-// 	cs := io.NewColumnSeries()
-// 	cs.AddColumn("Epoch", []int64{epoch})
-// 	cs.AddColumn("Open", []float32{float32(open)})
-// 	cs.AddColumn("High", []float32{float32(high)})
-// 	cs.AddColumn("Low", []float32{float32(low)})
-// 	cs.AddColumn("Close", []float32{float32(close)})
-// 	cs.AddColumn("Volume", []int32{int32(volume)})
-
-// 	pf.Lock()
-// 	defer pf.Unlock()
-
-// 	pf.CSM().AddColumnSeries(*tbk, cs)
-
-// 	if len(pf.CSM().GetMetadataKeys()) >= 1000 || pf.Age() >= time.Second {
-// 		// write the batch of records
-// 		if err := executor.WriteCSM(pf.CSM(), false); err != nil {
-// 			glog.Errorf("csm write failed (%v)", err)
-// 			return
-// 		}
-
-// 		// clear the csm for new records
-// 		pf.Refresh()
-// 	}
-// }
-
-// func (pf *PolygonFetcher) workBackfill() {
-// 	ticker := time.NewTicker(30 * time.Second)
-
-// 	for range ticker.C {
-// 		// range over symbols that need backfilling, and
-// 		// backfill them from the last written record
-// 		pf.backfillM.Range(func(key, value interface{}) bool {
-// 			symbol := key.(string)
-
-// 			// make sure epoch value isn't nil (i.e. hasn't
-// 			// been backfilled already)
-// 			if value != nil {
-// 				backfill(symbol, *value.(*int64))
-// 				pf.backfillM.Store(key, nil)
-// 			}
-
-// 			return true
-// 		})
-// 	}
-// }
-
-// func backfill(symbol string, endEpoch int64) {
-// 	var csm io.ColumnSeriesMap
-// 	tbk := io.NewTimeBucketKey(fmt.Sprintf("%s/1Min/OHLCV", symbol))
-
-// 	// query the latest entry prior to the streamed record
-// 	{
-// 		instance := executor.ThisInstance
-// 		cDir := instance.CatalogDir
-// 		q := planner.NewQuery(cDir)
-// 		q.AddTargetKey(tbk)
-// 		q.SetRowLimit(io.LAST, 1)
-// 		q.SetEnd(endEpoch - int64(time.Minute.Seconds()))
-
-// 		parsed, err := q.Parse()
-// 		if err != nil {
-// 			glog.Errorf("query parse error for %v (%v)", tbk.String(), err)
-// 			return
-// 		}
-
-// 		scanner, err := executor.NewReader(parsed)
-// 		if err != nil {
-// 			glog.Errorf("new scanner error for %v (%v)", tbk.String(), err)
-// 			return
-// 		}
-
-// 		csm, _, err = scanner.Read()
-// 		if err != nil {
-// 			glog.Errorf("scanner read error for %v (%v)", tbk.String(), err)
-// 			return
-// 		}
-// 	}
-
-// 	epoch := csm[*tbk].GetEpoch()
-
-// 	// no gap to fill
-// 	if len(epoch) == 0 {
-// 		return
-// 	}
-
-// 	// request & write the missing bars
-// 	{
-// 		resp, err := api.GetAggregates(symbol, time.Unix(epoch[len(epoch)-1], 0))
-
-// 		if err != nil {
-// 			glog.Errorf("failed to backfill aggregates for %v (%v)", tbk.String(), err)
-// 			return
-// 		}
-
-// 		if len(resp.Ticks) == 0 {
-// 			return
-// 		}
-
-// 		csm = io.NewColumnSeriesMap()
-
-// 		epoch = make([]int64, len(resp.Ticks))
-// 		open := make([]float32, len(resp.Ticks))
-// 		high := make([]float32, len(resp.Ticks))
-// 		low := make([]float32, len(resp.Ticks))
-// 		close := make([]float32, len(resp.Ticks))
-// 		volume := make([]int32, len(resp.Ticks))
-
-// 		for i, bar := range resp.Ticks {
-// 			epoch[i] = bar.EpochMillis / 1000
-// 			open[i] = float32(bar.Open)
-// 			high[i] = float32(bar.High)
-// 			low[i] = float32(bar.Low)
-// 			close[i] = float32(bar.Close)
-// 			volume[i] = int32(bar.Volume)
-// 		}
-
-// 		cs := io.NewColumnSeries()
-// 		cs.AddColumn("Epoch", epoch)
-// 		cs.AddColumn("Open", open)
-// 		cs.AddColumn("High", high)
-// 		cs.AddColumn("Low", low)
-// 		cs.AddColumn("Close", close)
-// 		cs.AddColumn("Volume", volume)
-// 		csm.AddColumnSeries(*tbk, cs)
-
-// 		if err := executor.WriteCSM(csm, false); err != nil {
-// 			glog.Errorf("csm write failed for %v (%v)", tbk.String(), err)
-// 			return
-// 		}
-// 	}
-// }
-
-// func main() {}
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/buger/jsonparser"
+
+	"github.com/alpacahq/marketstore/contrib/polygon/api"
+	"github.com/alpacahq/marketstore/executor"
+	"github.com/alpacahq/marketstore/planner"
+	"github.com/alpacahq/marketstore/plugins/bgworker"
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/golang/glog"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	polygonWSURL = "wss://socket.polygon.io/stocks"
+
+	initialBackoff = time.Second
+	maxBackoff     = time.Minute
+)
+
+// timeframe maps a TimeBucketKey timeframe string to the multiplier/timespan
+// pair Polygon's aggregates endpoint expects.
+type timeframe struct {
+	multiplier int
+	timespan   string
+}
+
+var timeframes = map[string]timeframe{
+	"1Min": {1, "minute"},
+	"5Min": {5, "minute"},
+	"1H":   {1, "hour"},
+	"1D":   {1, "day"},
+}
+
+type PolygonFetcher struct {
+	sync.Mutex
+	config        FetcherConfig
+	conn          *websocket.Conn
+	backfillM     sync.Map
+	csm           *io.ColumnSeriesMap
+	refreshedAt   time.Time
+	pendingCursor sync.Map // symbol -> most recent unflushed epoch (int64)
+}
+
+func (f *PolygonFetcher) CSM() io.ColumnSeriesMap {
+	return *f.csm
+}
+
+func (f *PolygonFetcher) Refresh() {
+	csm := io.NewColumnSeriesMap()
+	f.csm = &csm
+	f.refreshedAt = time.Now()
+}
+
+func (f *PolygonFetcher) Age() time.Duration {
+	return time.Now().Sub(f.refreshedAt)
+}
+
+type FetcherConfig struct {
+	// polygon API key for authenticating with their APIs
+	APIKey string `json:"api_key"`
+	// polygon API base URL in case it is being proxied
+	// (defaults to https://api.polygon.io/)
+	BaseURL string `json:"base_url"`
+	// Symbols to subscribe to. Defaults to none, which subscribes to
+	// nothing - operators must list the symbols they want.
+	Symbols []string `json:"symbols"`
+	// Channels selects which Polygon websocket channels to subscribe to
+	// per symbol, e.g. "AM" (minute aggregates), "A" (second
+	// aggregates), "T" (trades) or "Q" (quotes). Defaults to ["AM"].
+	Channels []string `json:"channels"`
+	// Timeframes to backfill on startup and after a reconnect gap.
+	// Defaults to ["1Min"].
+	Timeframes []string `json:"timeframes"`
+}
+
+// NewBgWorker returns a new instances of PolygonFetcher. See FetcherConfig
+// for more details about configuring PolygonFetcher.
+func NewBgWorker(conf map[string]interface{}) (bgworker.BgWorker, error) {
+	data, _ := json.Marshal(conf)
+	config := FetcherConfig{}
+	json.Unmarshal(data, &config)
+
+	if len(config.Channels) == 0 {
+		config.Channels = []string{"AM"}
+	}
+	if len(config.Timeframes) == 0 {
+		config.Timeframes = []string{"1Min"}
+	}
+
+	fetcher := &PolygonFetcher{
+		backfillM: sync.Map{},
+		config:    config,
+	}
+
+	fetcher.Refresh()
+
+	return fetcher, nil
+}
+
+// Run the PolygonFetcher. It starts the streaming websocket as well as the
+// asynchronous backfilling routine.
+func (pf *PolygonFetcher) Run() {
+	api.SetAPIKey(pf.config.APIKey)
+
+	if pf.config.BaseURL != "" {
+		api.SetBaseURL(pf.config.BaseURL)
+	}
+
+	go pf.workBackfill()
+
+	pf.streamWithReconnect()
+}
+
+// streamWithReconnect dials the Polygon websocket and redials with
+// exponential backoff and jitter whenever the connection drops, resuming
+// the same channel/symbol subscription, mirroring the SubscribeResilient
+// reconnect pattern used by the marketstore client. The backoff resets once
+// a connection has stayed up for at least maxBackoff, so a long-lived
+// worker that drops once after hours of healthy streaming doesn't inherit
+// a stale attempt count.
+func (pf *PolygonFetcher) streamWithReconnect() {
+	attempt := 0
+	for {
+		connectedAt := time.Now()
+		err := pf.stream()
+		if err != nil {
+			glog.Errorf("polygon websocket error, reconnecting (%v)", err)
+		}
+
+		if time.Since(connectedAt) >= maxBackoff {
+			attempt = 0
+		}
+
+		backoff := backoffDuration(initialBackoff, maxBackoff, attempt)
+		time.Sleep(backoff)
+		attempt++
+	}
+}
+
+// backoffDuration returns min(max, initial*2^attempt) plus jitter in
+// [0, initial], capping attempt so the shift can't overflow into a
+// wrapped-around (and therefore tiny) duration on a long-lived reconnect
+// loop.
+func backoffDuration(initial, max time.Duration, attempt int) time.Duration {
+	const maxShift = 32
+	if attempt > maxShift {
+		attempt = maxShift
+	}
+
+	backoff := initial << uint(attempt)
+	if backoff > max || backoff < 0 {
+		backoff = max
+	}
+	return backoff + time.Duration(rand.Int63n(int64(initial)+1))
+}
+
+// stream opens a single websocket connection, authenticates, subscribes to
+// the configured channels/symbols, and pumps incoming messages until the
+// connection is closed or errors.
+func (pf *PolygonFetcher) stream() error {
+	conn, _, err := websocket.DefaultDialer.Dial(polygonWSURL, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	pf.Lock()
+	pf.conn = conn
+	pf.Unlock()
+
+	if err := conn.WriteJSON(map[string]string{
+		"action": "auth",
+		"params": pf.config.APIKey,
+	}); err != nil {
+		return err
+	}
+
+	params := make([]string, 0, len(pf.config.Channels)*len(pf.config.Symbols))
+	for _, channel := range pf.config.Channels {
+		for _, symbol := range pf.config.Symbols {
+			params = append(params, fmt.Sprintf("%s.%s", channel, symbol))
+		}
+	}
+	if err := conn.WriteJSON(map[string]string{
+		"action": "subscribe",
+		"params": strings.Join(params, ","),
+	}); err != nil {
+		return err
+	}
+
+	conn.SetPingHandler(func(data string) error {
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+
+	for {
+		msgType, msg, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if msgType != websocket.TextMessage && msgType != websocket.BinaryMessage {
+			continue
+		}
+		pf.handleMessages(msg)
+	}
+}
+
+// handleMessages dispatches each event in a Polygon websocket frame, which
+// batches one or more JSON event objects into a top-level array.
+func (pf *PolygonFetcher) handleMessages(msg []byte) {
+	_, err := jsonparser.ArrayEach(msg, func(value []byte, _ jsonparser.ValueType, _ int, _ error) {
+		ev, _ := jsonparser.GetString(value, "ev")
+		switch ev {
+		case "AM":
+			pf.handleAggregate(value)
+		case "A":
+			pf.handleSecondAggregate(value)
+		case "T":
+			pf.handleTrade(value)
+		case "Q":
+			pf.handleQuote(value)
+		}
+	})
+	if err != nil {
+		glog.Errorf("error parsing polygon message (%v)", err)
+	}
+}
+
+func (pf *PolygonFetcher) handleAggregate(data []byte) {
+	symbol, _ := jsonparser.GetString(data, "sym")
+	open, _ := jsonparser.GetFloat(data, "o")
+	high, _ := jsonparser.GetFloat(data, "h")
+	low, _ := jsonparser.GetFloat(data, "l")
+	close, _ := jsonparser.GetFloat(data, "c")
+	volume, _ := jsonparser.GetInt(data, "v")
+	epochMillis, _ := jsonparser.GetInt(data, "s")
+
+	epoch := epochMillis / 1000
+
+	pf.backfillM.LoadOrStore(symbol, &epoch)
+
+	tbk := io.NewTimeBucketKeyFromString(fmt.Sprintf("%s/1Min/OHLCV", symbol))
+
+	cs := io.NewColumnSeries()
+	cs.AddColumn("Epoch", []int64{epoch})
+	cs.AddColumn("Open", []float32{float32(open)})
+	cs.AddColumn("High", []float32{float32(high)})
+	cs.AddColumn("Low", []float32{float32(low)})
+	cs.AddColumn("Close", []float32{float32(close)})
+	cs.AddColumn("Volume", []int32{int32(volume)})
+
+	pf.writeAndMaybeFlush(*tbk, cs)
+	pf.pendingCursor.Store(symbol, epoch)
+}
+
+func (pf *PolygonFetcher) handleTrade(data []byte) {
+	symbol, _ := jsonparser.GetString(data, "sym")
+	price, _ := jsonparser.GetFloat(data, "p")
+	size, _ := jsonparser.GetInt(data, "s")
+	epochMillis, _ := jsonparser.GetInt(data, "t")
+
+	epoch := epochMillis / 1000
+
+	tbk := io.NewTimeBucketKeyFromString(fmt.Sprintf("%s/1Sec/TRADE", symbol))
+
+	cs := io.NewColumnSeries()
+	cs.AddColumn("Epoch", []int64{epoch})
+	cs.AddColumn("Price", []float32{float32(price)})
+	cs.AddColumn("Size", []int32{int32(size)})
+
+	pf.writeAndMaybeFlush(*tbk, cs)
+}
+
+func (pf *PolygonFetcher) handleSecondAggregate(data []byte) {
+	symbol, _ := jsonparser.GetString(data, "sym")
+	open, _ := jsonparser.GetFloat(data, "o")
+	high, _ := jsonparser.GetFloat(data, "h")
+	low, _ := jsonparser.GetFloat(data, "l")
+	close, _ := jsonparser.GetFloat(data, "c")
+	volume, _ := jsonparser.GetInt(data, "v")
+	epochMillis, _ := jsonparser.GetInt(data, "s")
+
+	epoch := epochMillis / 1000
+
+	tbk := io.NewTimeBucketKeyFromString(fmt.Sprintf("%s/1Sec/OHLCV", symbol))
+
+	cs := io.NewColumnSeries()
+	cs.AddColumn("Epoch", []int64{epoch})
+	cs.AddColumn("Open", []float32{float32(open)})
+	cs.AddColumn("High", []float32{float32(high)})
+	cs.AddColumn("Low", []float32{float32(low)})
+	cs.AddColumn("Close", []float32{float32(close)})
+	cs.AddColumn("Volume", []int32{int32(volume)})
+
+	pf.writeAndMaybeFlush(*tbk, cs)
+}
+
+func (pf *PolygonFetcher) handleQuote(data []byte) {
+	symbol, _ := jsonparser.GetString(data, "sym")
+	bidPrice, _ := jsonparser.GetFloat(data, "bp")
+	bidSize, _ := jsonparser.GetInt(data, "bs")
+	askPrice, _ := jsonparser.GetFloat(data, "ap")
+	askSize, _ := jsonparser.GetInt(data, "as")
+	epochMillis, _ := jsonparser.GetInt(data, "t")
+
+	epoch := epochMillis / 1000
+
+	tbk := io.NewTimeBucketKeyFromString(fmt.Sprintf("%s/1Sec/QUOTE", symbol))
+
+	cs := io.NewColumnSeries()
+	cs.AddColumn("Epoch", []int64{epoch})
+	cs.AddColumn("BidPrice", []float32{float32(bidPrice)})
+	cs.AddColumn("BidSize", []int32{int32(bidSize)})
+	cs.AddColumn("AskPrice", []float32{float32(askPrice)})
+	cs.AddColumn("AskSize", []int32{int32(askSize)})
+
+	pf.writeAndMaybeFlush(*tbk, cs)
+}
+
+func (pf *PolygonFetcher) writeAndMaybeFlush(tbk io.TimeBucketKey, cs *io.ColumnSeries) {
+	pf.Lock()
+	defer pf.Unlock()
+
+	pf.CSM().AddColumnSeries(tbk, cs)
+
+	if len(pf.CSM().GetMetadataKeys()) >= 1000 || pf.Age() >= time.Second {
+		pf.mergePendingCursors()
+
+		// write the batch of records
+		if err := executor.WriteCSM(pf.CSM(), false); err != nil {
+			glog.Errorf("csm write failed (%v)", err)
+			return
+		}
+
+		// clear the csm for new records
+		pf.Refresh()
+	}
+}
+
+// mergePendingCursors folds each symbol's pending last-seen epoch (queued by
+// handleAggregate) into the in-flight CSM as a SYMBOL/1D/CURSOR record, so
+// the cursor update rides the same batched write as the data it tracks
+// instead of a synchronous executor.WriteCSM call per message. Only the
+// latest epoch per symbol per UTC day is retained - that's the point: the
+// cursor only needs to say where to resume backfilling from, not keep a
+// history.
+func (pf *PolygonFetcher) mergePendingCursors() {
+	pf.pendingCursor.Range(func(key, value interface{}) bool {
+		symbol := key.(string)
+		epoch := value.(int64)
+
+		tbk := io.NewTimeBucketKeyFromString(fmt.Sprintf("%s/1D/CURSOR", symbol))
+		cs := io.NewColumnSeries()
+		cs.AddColumn("Epoch", []int64{epoch})
+		pf.CSM().AddColumnSeries(*tbk, cs)
+
+		pf.pendingCursor.Delete(key)
+		return true
+	})
+}
+
+// readCursor reads the last persisted epoch for symbol, or 0 if none has
+// been written yet.
+func readCursor(symbol string) int64 {
+	tbk := io.NewTimeBucketKeyFromString(fmt.Sprintf("%s/1D/CURSOR", symbol))
+
+	instance := executor.ThisInstance
+	cDir := instance.CatalogDir
+	q := planner.NewQuery(cDir)
+	q.AddTargetKey(tbk)
+	q.SetRowLimit(io.LAST, 1)
+
+	parsed, err := q.Parse()
+	if err != nil {
+		return 0
+	}
+
+	scanner, err := executor.NewReader(parsed)
+	if err != nil {
+		return 0
+	}
+
+	csm, _, err := scanner.Read()
+	if err != nil {
+		return 0
+	}
+
+	epoch := csm[*tbk].GetEpoch()
+	if len(epoch) == 0 {
+		return 0
+	}
+
+	return epoch[len(epoch)-1]
+}
+
+func (pf *PolygonFetcher) workBackfill() {
+	for _, symbol := range pf.config.Symbols {
+		if cursor := readCursor(symbol); cursor != 0 {
+			pf.backfillM.Store(symbol, &cursor)
+		}
+	}
+
+	ticker := time.NewTicker(30 * time.Second)
+
+	for range ticker.C {
+		// range over symbols that need backfilling, and
+		// backfill them from the last written record
+		pf.backfillM.Range(func(key, value interface{}) bool {
+			symbol := key.(string)
+
+			// make sure epoch value isn't nil (i.e. hasn't
+			// been backfilled already)
+			if value != nil {
+				backfill(symbol, *value.(*int64), pf.config.Timeframes)
+				pf.backfillM.Store(key, nil)
+			}
+
+			return true
+		})
+	}
+}
+
+// backfill fills the gap after the last record written before endEpoch for
+// each of the given timeframes (e.g. "1Min", "5Min", "1H", "1D"), querying
+// Polygon's aggregates endpoint with the multiplier/timespan that matches
+// each timeframe, from that record through the current time, and writing
+// the results into the corresponding TimeBucketKey.
+func backfill(symbol string, endEpoch int64, frames []string) {
+	for _, frame := range frames {
+		tf, ok := timeframes[frame]
+		if !ok {
+			glog.Errorf("unknown backfill timeframe %s", frame)
+			continue
+		}
+		backfillTimeframe(symbol, endEpoch, frame, tf)
+	}
+}
+
+func backfillTimeframe(symbol string, endEpoch int64, frame string, tf timeframe) {
+	var csm io.ColumnSeriesMap
+	tbk := io.NewTimeBucketKey(fmt.Sprintf("%s/%s/OHLCV", symbol, frame))
+
+	// query the latest entry prior to the streamed record
+	{
+		instance := executor.ThisInstance
+		cDir := instance.CatalogDir
+		q := planner.NewQuery(cDir)
+		q.AddTargetKey(tbk)
+		q.SetRowLimit(io.LAST, 1)
+		q.SetEnd(endEpoch - int64(time.Minute.Seconds()))
+
+		parsed, err := q.Parse()
+		if err != nil {
+			glog.Errorf("query parse error for %v (%v)", tbk.String(), err)
+			return
+		}
+
+		scanner, err := executor.NewReader(parsed)
+		if err != nil {
+			glog.Errorf("new scanner error for %v (%v)", tbk.String(), err)
+			return
+		}
+
+		csm, _, err = scanner.Read()
+		if err != nil {
+			glog.Errorf("scanner read error for %v (%v)", tbk.String(), err)
+			return
+		}
+	}
+
+	epoch := csm[*tbk].GetEpoch()
+
+	// no gap to fill
+	if len(epoch) == 0 {
+		return
+	}
+
+	// request & write the missing bars
+	{
+		resp, err := api.GetAggregates(symbol, tf.multiplier, tf.timespan, time.Unix(epoch[len(epoch)-1], 0))
+
+		if err != nil {
+			glog.Errorf("failed to backfill aggregates for %v (%v)", tbk.String(), err)
+			return
+		}
+
+		if len(resp.Ticks) == 0 {
+			return
+		}
+
+		csm = io.NewColumnSeriesMap()
+
+		epoch = make([]int64, len(resp.Ticks))
+		open := make([]float32, len(resp.Ticks))
+		high := make([]float32, len(resp.Ticks))
+		low := make([]float32, len(resp.Ticks))
+		close := make([]float32, len(resp.Ticks))
+		volume := make([]int32, len(resp.Ticks))
+
+		for i, bar := range resp.Ticks {
+			epoch[i] = bar.EpochMillis / 1000
+			open[i] = float32(bar.Open)
+			high[i] = float32(bar.High)
+			low[i] = float32(bar.Low)
+			close[i] = float32(bar.Close)
+			volume[i] = int32(bar.Volume)
+		}
+
+		cs := io.NewColumnSeries()
+		cs.AddColumn("Epoch", epoch)
+		cs.AddColumn("Open", open)
+		cs.AddColumn("High", high)
+		cs.AddColumn("Low", low)
+		cs.AddColumn("Close", close)
+		cs.AddColumn("Volume", volume)
+		csm.AddColumnSeries(*tbk, cs)
+
+		if err := executor.WriteCSM(csm, false); err != nil {
+			glog.Errorf("csm write failed for %v (%v)", tbk.String(), err)
+			return
+		}
+	}
+}
+
+func main() {}
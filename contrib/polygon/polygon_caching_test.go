@@ -0,0 +1,19 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestBackoffDurationOverflowGuard guards against initial<<attempt
+// overflowing time.Duration (an int64) once attempt climbs past ~63
+// without streamWithReconnect ever resetting its counter.
+func TestBackoffDurationOverflowGuard(t *testing.T) {
+	const max = time.Minute
+	for _, attempt := range []int{34, 63, 1000} {
+		got := backoffDuration(time.Second, max, attempt)
+		if got < 0 || got > max+time.Second {
+			t.Fatalf("attempt %d: got backoff %v, want in [0, %v]", attempt, got, max+time.Second)
+		}
+	}
+}
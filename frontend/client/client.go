@@ -1,12 +1,17 @@
 package client
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"encoding/base64"
 	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/alpacahq/marketstore/frontend"
@@ -32,7 +37,20 @@ func NewClient(baseurl string) (cl *Client, err error) {
 	return cl, nil
 }
 
+// DoRPC does a remote procedure call using the msgpack2 protocol for RPC that
+// return a QueryReply. It is a thin wrapper around DoRPCContext using
+// context.Background(), kept for callers that don't need cancellation.
 func (cl *Client) DoRPC(functionName string, args interface{}) (csm io.ColumnSeriesMap, err error) {
+	return cl.DoRPCContext(context.Background(), functionName, args)
+}
+
+// DoRPCContext does a remote procedure call using the msgpack2 protocol for
+// RPC that return a QueryReply. The supplied context is attached to the
+// outgoing request: if ctx is canceled or its deadline expires before the
+// server responds, the request is aborted and client.Do returns whatever
+// error net/http surfaces for that (unwrapped and returned as-is; it is not
+// re-wrapped here).
+func (cl *Client) DoRPCContext(ctx context.Context, functionName string, args interface{}) (csm io.ColumnSeriesMap, err error) {
 	/*
 		Does a remote procedure call using the msgpack2 protocol for RPC that return a QueryReply
 	*/
@@ -49,6 +67,7 @@ func (cl *Client) DoRPC(functionName string, args interface{}) (csm io.ColumnSer
 	if err != nil {
 		return nil, err
 	}
+	req = req.WithContext(ctx)
 	req.Header.Set("Content-Type", "application/x-msgpack")
 	client := new(http.Client)
 	resp, err := client.Do(req)
@@ -126,16 +145,33 @@ func ColumnSeriesFromResult(shapes []io.DataShape, columns map[string]interface{
 }
 
 // Subscribe to the marketstore websocket interface with a
-// message handler, a set of streams and cancel channel.
+// message handler, a set of streams and cancel channel. It is a thin
+// wrapper around SubscribeContext using context.Background(), kept for
+// callers that don't need cancellation or a deadline.
 func (cl *Client) Subscribe(
 	handler func(pl stream.Payload) error,
 	cancel <-chan struct{},
 	streams ...string) (done <-chan struct{}, err error) {
 
+	return cl.SubscribeContext(context.Background(), handler, cancel, streams...)
+}
+
+// SubscribeContext subscribes to the marketstore websocket interface with a
+// message handler, a set of streams and cancel channel. If ctx carries a
+// deadline, the dial, subscribe handshake and every subsequent read are
+// bounded by it; when ctx is canceled or its deadline expires, a close
+// message is sent to the peer and the stream is torn down.
+func (cl *Client) SubscribeContext(
+	ctx context.Context,
+	handler func(pl stream.Payload) error,
+	cancel <-chan struct{},
+	streams ...string) (done <-chan struct{}, err error) {
+
 	u, _ := url.Parse(cl.BaseURL + "/ws")
 	u.Scheme = "ws"
 
-	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	dialer := websocket.DefaultDialer
+	conn, _, err := dialer.DialContext(ctx, u.String(), nil)
 
 	if err != nil {
 		return nil, err
@@ -162,21 +198,301 @@ func (cl *Client) Subscribe(
 			conn.Close()
 			return nil, fmt.Errorf("marketstore stream subscribe failed")
 		}
+	case <-ctx.Done():
+		conn.Close()
+		return nil, ctx.Err()
 	case <-time.After(10 * time.Second):
 		// timeout
 		conn.Close()
 		return nil, fmt.Errorf("marketstore stream subscribe timed out")
 	}
 
-	return streamConn(conn, handler, cancel), nil
+	return streamConn(ctx, conn, handler, cancel), nil
+}
+
+// ResilientOptions configures the reconnect behavior of SubscribeResilient.
+type ResilientOptions struct {
+	// InitialBackoff is the sleep duration before the first reconnect
+	// attempt; it doubles on each subsequent attempt.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the (pre-jitter) sleep duration between attempts.
+	MaxBackoff time.Duration
+	// MaxRetries bounds the number of reconnect attempts; 0 means retry
+	// forever.
+	MaxRetries int
+	// OnReconnect, if set, is called before each redial attempt with the
+	// attempt number (starting at 1), the error that ended the previous
+	// connection, and the time each stream's most recently delivered
+	// payload was seen (absent if no payload for that stream has been
+	// delivered yet). A caller can use lastSeen to request a server-side
+	// backfill of whatever gap the outage left before live delivery
+	// resumes.
+	OnReconnect func(attempt int, err error, lastSeen map[string]time.Time)
+}
+
+// SubscribeResilient subscribes to streams like Subscribe, but transparently
+// redials and resubscribes whenever the connection ends, whether by an error
+// or by a normal closure from the server, instead of giving up. Reconnect attempts sleep for min(MaxBackoff, InitialBackoff*2^attempt)
+// plus random jitter, matching the backoff used by other gorilla/websocket
+// streaming clients. The returned done channel closes only when cancel
+// fires or MaxRetries is exhausted.
+//
+// For each stream it tracks the time the most recently delivered payload was
+// received, and passes a snapshot of that to opts.OnReconnect so the caller
+// can decide whether to request a server-side backfill of the gap before
+// resuming live delivery.
+func (cl *Client) SubscribeResilient(
+	handler func(pl stream.Payload) error,
+	cancel <-chan struct{},
+	opts ResilientOptions,
+	streams ...string) (done <-chan struct{}, err error) {
+
+	trackingHandler, snapshotLastSeen := newLastSeenTracker(handler)
+
+	connect := func() error {
+		connDone, dialErr := cl.Subscribe(trackingHandler, cancel, streams...)
+		if dialErr != nil {
+			return dialErr
+		}
+		// block until the connection drops or cancel fires
+		select {
+		case <-connDone:
+			return fmt.Errorf("stream connection closed")
+		case <-cancel:
+			return nil
+		}
+	}
+
+	return runResilient(cancel, opts, snapshotLastSeen, "marketstore stream subscribe", connect), nil
+}
+
+// newLastSeenTracker wraps handler so that every delivered payload updates
+// a per-stream last-seen timestamp, and returns a func that snapshots those
+// timestamps for passing to ResilientOptions.OnReconnect.
+func newLastSeenTracker(handler func(pl stream.Payload) error) (tracking func(pl stream.Payload) error, snapshot func() map[string]time.Time) {
+	var lastSeen sync.Map // stream name -> time.Time of last delivered payload
+
+	tracking = func(pl stream.Payload) error {
+		lastSeen.Store(pl.Key, time.Now())
+		return handler(pl)
+	}
+
+	snapshot = func() map[string]time.Time {
+		out := make(map[string]time.Time)
+		lastSeen.Range(func(key, value interface{}) bool {
+			out[key.(string)] = value.(time.Time)
+			return true
+		})
+		return out
+	}
+
+	return tracking, snapshot
+}
+
+// runResilient drives connect in a loop, redialing with backoff whenever it
+// returns, until cancel fires or opts.MaxRetries is exhausted. connect
+// should block for the lifetime of one connection and return the error that
+// ended it (or nil if cancel ended it or it ended without an error); a nil
+// return is treated like an error unless cancel has fired. This is the shared reconnect driver
+// behind both SubscribeResilient and SubscribeSSE, so their backoff/retry
+// behavior can't drift between the two transports.
+func runResilient(
+	cancel <-chan struct{},
+	opts ResilientOptions,
+	snapshotLastSeen func() map[string]time.Time,
+	logPrefix string,
+	connect func() error) <-chan struct{} {
+
+	doneCh := make(chan struct{}, 1)
+
+	go func() {
+		defer close(doneCh)
+
+		attempt := 0
+		for {
+			connectedAt := time.Now()
+			dialErr := connect()
+
+			select {
+			case <-cancel:
+				return
+			default:
+			}
+
+			if opts.MaxBackoff > 0 && time.Since(connectedAt) >= opts.MaxBackoff {
+				attempt = 0
+			}
+
+			attempt++
+			if opts.MaxRetries > 0 && attempt > opts.MaxRetries {
+				glog.Errorf("%s giving up after %d attempts (%v)", logPrefix, attempt-1, dialErr)
+				return
+			}
+
+			if opts.OnReconnect != nil {
+				opts.OnReconnect(attempt, dialErr, snapshotLastSeen())
+			}
+
+			select {
+			case <-time.After(reconnectBackoff(opts.InitialBackoff, opts.MaxBackoff, attempt-1)):
+			case <-cancel:
+				return
+			}
+		}
+	}()
+
+	return doneCh
+}
+
+// minReconnectBackoff floors InitialBackoff so a zero-value ResilientOptions
+// (the caller forgot to set it, or simply didn't care) can't collapse every
+// reconnect sleep to 0 and hot-loop against the server.
+const minReconnectBackoff = 50 * time.Millisecond
+
+// reconnectBackoff returns min(max, initial*2^attempt) plus jitter in
+// [0, initial]; a max of 0 leaves initial*2^attempt uncapped. initial is floored to minReconnectBackoff; attempt is
+// capped before shifting so a long-lived reconnect loop that never resets
+// its counter can't overflow the shift into a wrapped-around (and
+// therefore near-zero) duration.
+func reconnectBackoff(initial, max time.Duration, attempt int) time.Duration {
+	if initial < minReconnectBackoff {
+		initial = minReconnectBackoff
+	}
+	if max != 0 && max < initial {
+		max = initial
+	}
+
+	const maxShift = 32
+	if attempt > maxShift {
+		attempt = maxShift
+	}
+
+	backoff := initial << uint(attempt)
+	if (max > 0 && backoff > max) || backoff < 0 {
+		backoff = max
+	}
+	return backoff + time.Duration(rand.Int63n(int64(initial)+1))
 }
 
+// SubscribeSSE subscribes to the same payload stream as Subscribe and
+// SubscribeResilient, but over the /events Server-Sent Events endpoint
+// instead of a websocket upgrade. This is a proxy-friendly option for
+// one-way consumers (browser dashboards, HTTP/2 proxies) that can't perform
+// a websocket handshake. It supports the same reconnect/backoff behavior as
+// SubscribeResilient via opts.
+func (cl *Client) SubscribeSSE(
+	handler func(pl stream.Payload) error,
+	cancel <-chan struct{},
+	opts ResilientOptions,
+	streams ...string) (done <-chan struct{}, err error) {
+
+	trackingHandler, snapshotLastSeen := newLastSeenTracker(handler)
+
+	connect := func() error {
+		return cl.readSSE(trackingHandler, cancel, streams...)
+	}
+
+	return runResilient(cancel, opts, snapshotLastSeen, "marketstore sse subscribe", connect), nil
+}
+
+// maxSSEFrameSize is the largest single "data:" line readSSE will accept.
+// bufio.Scanner's default 64KB token limit is too small for a base64'd
+// msgpack payload carrying a large bar/quote batch; exceeding it silently
+// ends the scan (bufio.ErrTooLong) and forces a reconnect.
+const maxSSEFrameSize = 8 << 20 // 8MiB
+
+// readSSE opens a single SSE connection to /events and delivers payloads to
+// handler until the connection drops, an error occurs, or cancel fires. It
+// returns the error that ended the connection, or nil if cancel fired or the
+// server ended the stream cleanly.
+func (cl *Client) readSSE(
+	handler func(pl stream.Payload) error,
+	cancel <-chan struct{},
+	streams ...string) error {
+
+	u, err := url.Parse(cl.BaseURL + "/events")
+	if err != nil {
+		return err
+	}
+	q := u.Query()
+	for _, s := range streams {
+		q.Add("streams", s)
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("sse subscribe failed (%d)", resp.StatusCode)
+	}
+
+	type result struct {
+		err error
+	}
+	done := make(chan result, 1)
+
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxSSEFrameSize)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if !strings.HasPrefix(line, "data:") {
+				continue
+			}
+			data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+
+			buf, err := base64.StdEncoding.DecodeString(data)
+			if err != nil {
+				glog.Errorf("error decoding sse frame (%v)", err)
+				continue
+			}
+
+			pl := stream.Payload{}
+			if err := msgpack.Unmarshal(buf, &pl); err != nil {
+				glog.Errorf("error unmarshaling sse frame (%v)", err)
+				continue
+			}
+
+			if err := handler(pl); err != nil {
+				glog.Errorf("error handling sse frame (%v)", err)
+			}
+		}
+		done <- result{err: scanner.Err()}
+	}()
+
+	select {
+	case r := <-done:
+		return r.err
+	case <-cancel:
+		resp.Body.Close()
+		return nil
+	}
+}
+
+// streamConn pumps decoded stream.Payload messages from c to handler until
+// cancel fires, ctx is done, or the connection is closed by the peer.
+//
+// The read loop selects on cancel and on ctx.Done(), which also fires when
+// ctx's deadline expires; whichever ends the loop, a CloseMessage is sent to
+// the peer before the read goroutine unwinds.
 func streamConn(
+	ctx context.Context,
 	c *websocket.Conn,
 	handler func(pl stream.Payload) error,
 	cancel <-chan struct{}) <-chan struct{} {
 
 	done := make(chan struct{}, 1)
+	closeOnce := make(chan struct{})
 
 	go func() {
 		defer c.Close()
@@ -206,11 +522,22 @@ func streamConn(
 				}
 			case <-cancel:
 				finished = true
+			case <-ctx.Done():
+				finished = true
 			}
 			if finished {
 				break
 			}
 		}
+
+		select {
+		case <-closeOnce:
+		default:
+			close(closeOnce)
+			deadline := time.Now().Add(time.Second)
+			c.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), deadline)
+		}
 	}()
 
 	return done
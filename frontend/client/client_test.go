@@ -0,0 +1,87 @@
+package client
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alpacahq/marketstore/frontend/stream"
+	"github.com/vmihailenco/msgpack"
+)
+
+// TestReconnectBackoffFloor guards against a zero-value ResilientOptions
+// (InitialBackoff and MaxBackoff both 0) collapsing every reconnect sleep
+// to 0 and hot-looping against the server.
+func TestReconnectBackoffFloor(t *testing.T) {
+	for attempt := 0; attempt < 5; attempt++ {
+		if got := reconnectBackoff(0, 0, attempt); got < minReconnectBackoff {
+			t.Fatalf("attempt %d: got backoff %v, want at least %v", attempt, got, minReconnectBackoff)
+		}
+	}
+}
+
+// TestReconnectBackoffOverflowGuard guards against initial<<attempt
+// overflowing time.Duration (an int64) for a reconnect loop whose attempt
+// counter climbs past ~63 without ever resetting.
+func TestReconnectBackoffOverflowGuard(t *testing.T) {
+	const max = time.Minute
+	for _, attempt := range []int{34, 63, 1000} {
+		got := reconnectBackoff(time.Second, max, attempt)
+		if got < 0 || got > max+time.Second {
+			t.Fatalf("attempt %d: got backoff %v, want in [0, %v]", attempt, got, max+time.Second)
+		}
+	}
+}
+
+// TestReadSSELargeFrame guards against a regression to bufio.Scanner's
+// default 64KB token limit: a single data: line carrying a payload bigger
+// than that must still be delivered, not silently dropped.
+func TestReadSSELargeFrame(t *testing.T) {
+	want := stream.Payload{Key: strings.Repeat("x", 100000)}
+
+	buf, err := msgpack.Marshal(want)
+	if err != nil {
+		t.Fatalf("marshaling fixture payload: %v", err)
+	}
+	frame := fmt.Sprintf("data: %s\n\n", base64.StdEncoding.EncodeToString(buf))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, frame)
+	}))
+	defer srv.Close()
+
+	cl, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	var got []stream.Payload
+	cancel := make(chan struct{})
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- cl.readSSE(func(pl stream.Payload) error {
+			got = append(got, pl)
+			return nil
+		}, cancel, "AAPL")
+	}()
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatalf("readSSE: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		close(cancel)
+		t.Fatal("timed out waiting for readSSE to drain the large frame")
+	}
+
+	if len(got) != 1 || got[0].Key != want.Key {
+		t.Fatalf("expected one payload with key len %d, got %+v", len(want.Key), got)
+	}
+}
@@ -0,0 +1,294 @@
+// Package conformance replays a versioned corpus of wire-format fixtures
+// against the marketstore client to guard against the RPC and streaming
+// decoders silently diverging from the server across releases. A subtle
+// msgpack2 or NumpyMultiDataset change should fail a test here instead of
+// quietly corrupting a downstream consumer's pipeline.
+//
+// Fixtures live under a vectors directory (conventionally
+// frontend/conformance/testdata/vectors) as one JSON manifest per vector,
+// each pointing at a sibling file of raw response/frame bytes captured from
+// a real server. Use cmd/mkvector to record new vectors from a live
+// marketstore.
+package conformance
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alpacahq/marketstore/frontend/client"
+	"github.com/alpacahq/marketstore/frontend/stream"
+	"github.com/alpacahq/marketstore/utils/io"
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack"
+)
+
+// ClientVector is a single RPC test vector: a request against
+// Client.DoRPC and the column values the decoded response must produce.
+type ClientVector struct {
+	// Name identifies the vector in test failure output.
+	Name string `json:"name"`
+	// Method is the DataService method under test, e.g. "Query".
+	Method string `json:"method"`
+	// Args is passed to Client.DoRPC verbatim.
+	Args interface{} `json:"args"`
+	// ResponseFile names the sibling file holding the raw msgpack2
+	// response bytes the server would have sent for Args.
+	ResponseFile string `json:"response_file"`
+	// Expected maps each TimeBucketKey string in the decoded
+	// ColumnSeriesMap to its expected columns (column name -> values).
+	Expected map[string]map[string]interface{} `json:"expected"`
+}
+
+// StreamVector is a single streaming test vector: an ordered list of
+// websocket frames and the stream.Payload values a subscriber must observe
+// after decoding them, in order.
+type StreamVector struct {
+	Name string `json:"name"`
+	// Streams is the subscription's stream filter list.
+	Streams []string `json:"streams"`
+	// FrameFiles names, in delivery order, the sibling files holding the
+	// raw msgpack-encoded frame bytes sent after the subscribe ack.
+	FrameFiles []string `json:"frame_files"`
+	// Expected is the ordered list of payloads a handler must observe.
+	Expected []stream.Payload `json:"expected"`
+}
+
+// RunClientVectors loads every *.json manifest in dir as a ClientVector,
+// replays it against an in-process httptest.Server that answers the vector's
+// method with its recorded response bytes, and asserts that
+// client.ConvertMultiQueryReplyToColumnSeries (via Client.DoRPC) reproduces
+// the expected column values bit-for-bit.
+func RunClientVectors(t *testing.T, dir string) {
+	vectors, err := loadClientVectors(dir)
+	if err != nil {
+		t.Fatalf("loading client vectors from %s: %v", dir, err)
+	}
+	if len(vectors) == 0 {
+		t.Skipf("no client vectors found in %s", dir)
+	}
+
+	for _, v := range vectors {
+		v := v
+		t.Run(v.Name, func(t *testing.T) {
+			response, err := ioutil.ReadFile(filepath.Join(dir, v.ResponseFile))
+			if err != nil {
+				t.Fatalf("reading response fixture: %v", err)
+			}
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/rpc" {
+					http.NotFound(w, r)
+					return
+				}
+				w.Header().Set("Content-Type", "application/x-msgpack")
+				w.Write(response)
+			}))
+			defer srv.Close()
+
+			cl, err := client.NewClient(srv.URL)
+			if err != nil {
+				t.Fatalf("NewClient: %v", err)
+			}
+
+			csm, err := cl.DoRPC(v.Method, v.Args)
+			if err != nil {
+				t.Fatalf("DoRPC(%s): %v", v.Method, err)
+			}
+
+			assertColumnSeriesMap(t, csm, v.Expected)
+		})
+	}
+}
+
+// ColumnSeriesMapToExpected converts a decoded ColumnSeriesMap into the same
+// JSON-shaped representation a vector manifest stores its Expected field as,
+// so a freshly captured response and a manifest loaded from disk can be
+// compared like-for-like instead of typed Go slices against []interface{}.
+func ColumnSeriesMapToExpected(csm io.ColumnSeriesMap) map[string]map[string]interface{} {
+	expected := make(map[string]map[string]interface{}, len(csm))
+	for tbk, cs := range csm {
+		expected[tbk.String()] = normalizeViaJSON(cs.GetColumns()).(map[string]interface{})
+	}
+	return expected
+}
+
+// normalizeViaJSON round-trips v through JSON so native Go values (int64,
+// float32 slices, etc.) and values already decoded from a JSON manifest
+// compare equal under reflect.DeepEqual.
+func normalizeViaJSON(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return v
+	}
+	return normalized
+}
+
+func assertColumnSeriesMap(t *testing.T, csm io.ColumnSeriesMap, expected map[string]map[string]interface{}) {
+	t.Helper()
+
+	actual := ColumnSeriesMapToExpected(csm)
+
+	if len(actual) != len(expected) {
+		t.Errorf("expected %d time buckets, got %d", len(expected), len(actual))
+	}
+	for tbkStr, expectedCols := range expected {
+		actualCols, ok := actual[tbkStr]
+		if !ok {
+			t.Errorf("missing time bucket %s in response", tbkStr)
+			continue
+		}
+		expectedNormalized := normalizeViaJSON(expectedCols)
+		for col, want := range expectedNormalized.(map[string]interface{}) {
+			got, ok := actualCols[col]
+			if !ok {
+				t.Errorf("%s: missing column %s", tbkStr, col)
+				continue
+			}
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("%s.%s: expected %v, got %v", tbkStr, col, want, got)
+			}
+		}
+	}
+}
+
+// RunStreamVectors loads every *.json manifest in dir as a StreamVector,
+// feeds its recorded frames through a mock websocket server wired to
+// Client.Subscribe, and asserts the handler observes exactly the expected
+// payloads in order.
+func RunStreamVectors(t *testing.T, dir string) {
+	vectors, err := loadStreamVectors(dir)
+	if err != nil {
+		t.Fatalf("loading stream vectors from %s: %v", dir, err)
+	}
+	if len(vectors) == 0 {
+		t.Skipf("no stream vectors found in %s", dir)
+	}
+
+	upgrader := websocket.Upgrader{}
+
+	for _, v := range vectors {
+		v := v
+		t.Run(v.Name, func(t *testing.T) {
+			frames := make([][]byte, len(v.FrameFiles))
+			for i, f := range v.FrameFiles {
+				buf, err := ioutil.ReadFile(filepath.Join(dir, f))
+				if err != nil {
+					t.Fatalf("reading frame fixture %s: %v", f, err)
+				}
+				frames[i] = buf
+			}
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				conn, err := upgrader.Upgrade(w, r, nil)
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+
+				// drain and ack the subscribe message
+				_, _, _ = conn.ReadMessage()
+				ack, _ := msgpack.Marshal(stream.SubscribeMessage{Streams: v.Streams})
+				if err := conn.WriteMessage(websocket.BinaryMessage, ack); err != nil {
+					return
+				}
+
+				for _, frame := range frames {
+					if err := conn.WriteMessage(websocket.BinaryMessage, frame); err != nil {
+						return
+					}
+				}
+				conn.WriteMessage(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			}))
+			defer srv.Close()
+
+			wsURL := "ws" + srv.URL[len("http"):]
+			cl, err := client.NewClient(wsURL)
+			if err != nil {
+				t.Fatalf("NewClient: %v", err)
+			}
+
+			var observed []stream.Payload
+			cancel := make(chan struct{})
+			done, err := cl.Subscribe(func(pl stream.Payload) error {
+				observed = append(observed, pl)
+				return nil
+			}, cancel, v.Streams...)
+			if err != nil {
+				t.Fatalf("Subscribe: %v", err)
+			}
+
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				close(cancel)
+				t.Fatalf("timed out waiting for stream vector %s", v.Name)
+			}
+
+			// observed came off the wire via msgpack while v.Expected was
+			// decoded from the vector's JSON manifest; round-trip both
+			// through JSON so e.g. a []byte Data column (base64 in JSON)
+			// compares equal instead of failing on representation alone.
+			if !reflect.DeepEqual(normalizeViaJSON(observed), normalizeViaJSON(v.Expected)) {
+				t.Errorf("expected payloads %+v, got %+v", v.Expected, observed)
+			}
+		})
+	}
+}
+
+func loadClientVectors(dir string) ([]ClientVector, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var vectors []ClientVector
+	for _, p := range paths {
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		v := ClientVector{}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, fmt.Errorf("%s: %v", p, err)
+		}
+		if v.ResponseFile == "" {
+			continue // not a client vector (likely a stream vector manifest)
+		}
+		vectors = append(vectors, v)
+	}
+	return vectors, nil
+}
+
+func loadStreamVectors(dir string) ([]StreamVector, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var vectors []StreamVector
+	for _, p := range paths {
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		v := StreamVector{}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, fmt.Errorf("%s: %v", p, err)
+		}
+		if len(v.FrameFiles) == 0 {
+			continue // not a stream vector manifest
+		}
+		vectors = append(vectors, v)
+	}
+	return vectors, nil
+}
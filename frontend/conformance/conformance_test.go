@@ -0,0 +1,26 @@
+package conformance
+
+import "testing"
+
+// vectorsDir is the conventional fixture directory both RunClientVectors and
+// RunStreamVectors scan; a manifest's own fields (ResponseFile vs
+// FrameFiles), not its subdirectory, determine which loader picks it up, so
+// both vector kinds can live side by side in one directory.
+const vectorsDir = "testdata/vectors"
+
+// TestVectors is the entrypoint that actually exercises this package: it
+// replays every client-RPC fixture in vectorsDir against RunClientVectors
+// and every streaming fixture against RunStreamVectors.
+//
+// Both helpers skip (rather than fail) when the directory holds no fixture
+// of their kind yet, so the "client" and "stream" subtests report "skipped"
+// - not a silent pass - until a vector pair is committed. Capture one with cmd/mkvector against a
+// live marketstore instance; see the package doc for the fixture layout.
+func TestVectors(t *testing.T) {
+	t.Run("client", func(t *testing.T) {
+		RunClientVectors(t, vectorsDir)
+	})
+	t.Run("stream", func(t *testing.T) {
+		RunStreamVectors(t, vectorsDir)
+	})
+}
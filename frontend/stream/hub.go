@@ -0,0 +1,113 @@
+package stream
+
+// hub.go is the single fan-out point stream transports are built on: both
+// the websocket endpoint (ServeWS) and the SSE endpoint (ServeSSE, in
+// sse.go) subscribe through it, and whatever produces stream data calls
+// Publish exactly once per Payload to reach every transport.
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack"
+)
+
+var upgrader = websocket.Upgrader{}
+
+var hub = struct {
+	sync.Mutex
+	subs map[chan Payload][]string
+}{subs: map[chan Payload][]string{}}
+
+// subscribe registers a new subscriber for streams and returns the channel
+// Publish will deliver matching payloads on, plus a func to unregister it.
+func subscribe(streams []string) (<-chan Payload, func()) {
+	sub := make(chan Payload, 64)
+
+	hub.Lock()
+	hub.subs[sub] = streams
+	hub.Unlock()
+
+	unsubscribe := func() {
+		hub.Lock()
+		delete(hub.subs, sub)
+		hub.Unlock()
+		close(sub)
+	}
+
+	return sub, unsubscribe
+}
+
+// Publish delivers pl to every subscriber - websocket or SSE - registered
+// for pl.Key. The write path and any bgworker that produces stream data
+// should call Publish rather than writing to transport connections
+// directly, so every transport observes the same payloads.
+func Publish(pl Payload) {
+	hub.Lock()
+	defer hub.Unlock()
+
+	for sub, streams := range hub.subs {
+		for _, s := range streams {
+			if s == pl.Key {
+				select {
+				case sub <- pl:
+				default:
+					glog.Errorf("stream subscriber too slow, dropping payload for %s", pl.Key)
+				}
+				break
+			}
+		}
+	}
+}
+
+func init() {
+	http.HandleFunc("/ws", ServeWS)
+	http.HandleFunc("/events", ServeSSE)
+}
+
+// ServeWS upgrades the request to a websocket connection, performs the
+// SubscribeMessage handshake Client.Subscribe expects (echo the requested
+// streams back as the ack), and pumps Payloads from the hub to the
+// connection until it errors or the peer disconnects.
+func ServeWS(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		glog.Errorf("websocket upgrade failed (%v)", err)
+		return
+	}
+	defer conn.Close()
+
+	_, buf, err := conn.ReadMessage()
+	if err != nil {
+		return
+	}
+	subMsg := &SubscribeMessage{}
+	if err := msgpack.Unmarshal(buf, subMsg); err != nil {
+		glog.Errorf("error unmarshaling subscribe message (%v)", err)
+		return
+	}
+
+	ack, err := msgpack.Marshal(subMsg)
+	if err != nil {
+		return
+	}
+	if err := conn.WriteMessage(websocket.BinaryMessage, ack); err != nil {
+		return
+	}
+
+	sub, unsubscribe := subscribe(subMsg.Streams)
+	defer unsubscribe()
+
+	for pl := range sub {
+		buf, err := msgpack.Marshal(pl)
+		if err != nil {
+			glog.Errorf("error marshaling stream payload (%v)", err)
+			continue
+		}
+		if err := conn.WriteMessage(websocket.BinaryMessage, buf); err != nil {
+			return
+		}
+	}
+}
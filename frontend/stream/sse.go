@@ -0,0 +1,102 @@
+package stream
+
+// sse.go adds a Server-Sent Events transport alongside the websocket
+// endpoint consumed by Client.Subscribe. It publishes the same
+// stream.Payload messages for browser dashboards, HTTP/2 proxies and other
+// read-only consumers that can't perform a websocket upgrade, by
+// subscribing through the same hub (see hub.go) ServeWS does - a Payload
+// handed to Publish reaches both transports.
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/golang/glog"
+	"github.com/vmihailenco/msgpack"
+)
+
+// ServeSSE handles the /events endpoint. The stream filter list is taken
+// from the repeated "streams" query parameter on a GET request, or from a
+// JSON body ({"streams": [...]}, the same shape as SubscribeMessage) on a
+// POST request. Payloads are msgpack-encoded and base64-encoded into the
+// "data:" frame, matching the websocket wire format, unless the request
+// sends "Accept: application/json", in which case each payload is
+// JSON-encoded instead.
+func ServeSSE(w http.ResponseWriter, r *http.Request) {
+	streams, err := parseSSEStreams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	asJSON := r.Header.Get("Accept") == "application/json"
+
+	sub, unsubscribe := subscribe(streams)
+	defer unsubscribe()
+
+	ctx := r.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case pl, ok := <-sub:
+			if !ok {
+				return
+			}
+			if err := writeSSEFrame(w, pl, asJSON); err != nil {
+				glog.Errorf("error writing sse frame (%v)", err)
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func parseSSEStreams(r *http.Request) (streams []string, err error) {
+	if r.Method == http.MethodPost {
+		msg := &SubscribeMessage{}
+		if err = json.NewDecoder(r.Body).Decode(msg); err != nil {
+			return nil, fmt.Errorf("invalid subscribe body (%s)", err)
+		}
+		streams = msg.Streams
+	} else {
+		streams = r.URL.Query()["streams"]
+	}
+
+	if len(streams) == 0 {
+		return nil, fmt.Errorf("no streams requested")
+	}
+	return streams, nil
+}
+
+func writeSSEFrame(w http.ResponseWriter, pl Payload, asJSON bool) (err error) {
+	if asJSON {
+		data, err := json.Marshal(pl)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+		return err
+	}
+
+	buf, err := msgpack.Marshal(pl)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "data: %s\n\n", base64.StdEncoding.EncodeToString(buf))
+	return err
+}